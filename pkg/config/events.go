@@ -0,0 +1,122 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Event describes a single config or template mutation, published so
+// consumers (e.g. Alloy agents) can react in real time instead of polling.
+type Event struct {
+	Op       string `json:"op"` // "set", "remove", "reload"
+	ID       string `json:"id,omitempty"`
+	Template string `json:"template,omitempty"`
+	Org      string `json:"org"`
+	TS       int64  `json:"ts"`
+}
+
+func newEvent(op, id, template, org string) Event {
+	return Event{Op: op, ID: id, Template: template, Org: org, TS: time.Now().Unix()}
+}
+
+// Subscribe registers a channel that receives every Event published by this
+// Storage, in both memory and Redis mode - in Redis mode, startRedisEventRelay
+// fans Pub/Sub messages from every shard into the same subscriber list. The
+// returned func unsubscribes and closes ch.
+func (s *Storage) Subscribe() (ch chan Event, unsubscribe func()) {
+	ch = make(chan Event, 32)
+
+	s.subMu.Lock()
+	s.subscribers = append(s.subscribers, ch)
+	s.subMu.Unlock()
+
+	unsubscribe = func() {
+		s.subMu.Lock()
+		defer s.subMu.Unlock()
+		for i, sub := range s.subscribers {
+			if sub == ch {
+				s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
+				close(ch)
+				break
+			}
+		}
+	}
+	return ch, unsubscribe
+}
+
+// RedisEventChannel returns the Pub/Sub channel name events are published to
+// for this Storage's organization.
+func (s *Storage) RedisEventChannel() string {
+	return fmt.Sprintf("{%s}:events", s.Organization)
+}
+
+// publish emits ev to every in-memory subscriber and, in Redis mode, to the
+// org's Pub/Sub channel. Publish errors are logged rather than returned so a
+// notification failure never fails the config mutation that triggered it.
+func (s *Storage) publish(ev Event) {
+	if s.UseRedis {
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			log.Printf("Error marshaling event: %v", err)
+			return
+		}
+		channel := s.RedisEventChannel()
+		sh := s.Shards.pickForWrite(channel)
+		err = sh.client.Publish(context.Background(), channel, payload).Err()
+		sh.recordReply(err)
+		if err != nil {
+			log.Printf("Error publishing event: %v", err)
+		}
+		return
+	}
+
+	s.broadcastLocal(ev)
+}
+
+// broadcastLocal fans ev out to every in-memory subscriber (used directly in
+// memory mode, and by the Redis Pub/Sub relay in Redis mode).
+func (s *Storage) broadcastLocal(ev Event) {
+	s.subMu.RLock()
+	defer s.subMu.RUnlock()
+	for _, sub := range s.subscribers {
+		select {
+		case sub <- ev:
+		default:
+			log.Printf("Event subscriber channel full, dropping event: %+v", ev)
+		}
+	}
+}
+
+func (s *Storage) publishTemplateEvent(op, template string) {
+	s.publish(newEvent(op, "", template, s.Organization))
+}
+
+// startRedisEventRelay subscribes to RedisEventChannel on every shard (a
+// publish can land on any shard depending on health/failover) and fans
+// received events into the in-memory subscriber list, so Storage.Subscribe
+// and ServeEvents work the same way in Redis mode as in memory mode.
+func (s *Storage) startRedisEventRelay() {
+	channel := s.RedisEventChannel()
+	for _, sh := range s.Shards.all() {
+		go s.relayShardEvents(sh, channel)
+	}
+}
+
+func (s *Storage) relayShardEvents(sh *shard, channel string) {
+	ctx := context.Background()
+	pubsub := sh.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var ev Event
+		if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+			log.Printf("Error unmarshaling event from shard %s: %v", sh.id, err)
+			continue
+		}
+		s.broadcastLocal(ev)
+	}
+}
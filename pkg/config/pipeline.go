@@ -0,0 +1,171 @@
+package config
+
+import (
+	"context"
+	"log"
+)
+
+// writeRequest is one pending SetWithTemplate mutation, queued for the
+// async write worker to apply via a pipelined batch.
+type writeRequest struct {
+	shard        *shard
+	key          string
+	content      string
+	templateKey  string
+	templateName string
+	indexKey     string
+	id           string
+}
+
+const defaultWriteBufferSize = 256
+
+// controlSignal asks the write worker to drain ("flush") or drain-then-stop
+// ("close"). ack is closed once the worker has actually finished draining,
+// so a caller blocking on ack (rather than on the send succeeding) knows the
+// drain is done, not just received.
+type controlSignal struct {
+	kind string // "flush" or "close"
+	ack  chan struct{}
+}
+
+// StartAsyncWrites switches Storage to buffered, coalesced writes: in Redis
+// mode, calls to Set/SetWithTemplate enqueue onto a channel drained by a
+// worker goroutine
+// that pipelines SET+EXPIRE (and the template/index bookkeeping) through
+// Redis's TxPipeline, so a burst of writes (e.g. many agents fetching
+// configs at once) turns into one round trip per shard instead of many.
+// Tests that want synchronous writes should simply not call this. Call
+// Flush or Close before shutdown to make sure queued writes land.
+func (s *Storage) StartAsyncWrites() {
+	s.asyncOnce.Do(func() {
+		s.writeCh = make(chan writeRequest, defaultWriteBufferSize)
+		s.signalCh = make(chan controlSignal)
+		s.async = true
+		s.writeWG.Add(1)
+		go s.runWriteWorker()
+	})
+}
+
+// runWriteWorker drains writeCh, coalescing whatever has piled up since the
+// last batch into a single pipelined write per shard, until it receives a
+// controlSignal. It acks the signal only after drainPending has actually
+// run, and on "close" it then returns (releasing writeWG).
+func (s *Storage) runWriteWorker() {
+	defer s.writeWG.Done()
+	for {
+		select {
+		case req := <-s.writeCh:
+			batch := []writeRequest{req}
+			collecting := true
+			for collecting {
+				select {
+				case next := <-s.writeCh:
+					batch = append(batch, next)
+				default:
+					collecting = false
+				}
+			}
+			s.applyBatch(batch)
+		case sig := <-s.signalCh:
+			s.drainPending()
+			close(sig.ack)
+			if sig.kind == "close" {
+				return
+			}
+		}
+	}
+}
+
+// drainPending applies every write currently sitting in writeCh without
+// waiting for more to arrive.
+func (s *Storage) drainPending() {
+	var batch []writeRequest
+	for {
+		select {
+		case req := <-s.writeCh:
+			batch = append(batch, req)
+		default:
+			if len(batch) > 0 {
+				s.applyBatch(batch)
+			}
+			return
+		}
+	}
+}
+
+func (s *Storage) applyBatch(batch []writeRequest) {
+	byShard := make(map[*shard][]writeRequest)
+	for _, req := range batch {
+		byShard[req.shard] = append(byShard[req.shard], req)
+	}
+	for sh, reqs := range byShard {
+		s.pipelineShardBatch(sh, reqs)
+	}
+}
+
+func (s *Storage) pipelineShardBatch(sh *shard, reqs []writeRequest) {
+	ctx := context.Background()
+	pipe := sh.client.TxPipeline()
+	for _, req := range reqs {
+		pipe.Set(ctx, req.key, req.content, 0)
+		pipe.Expire(ctx, req.key, s.TTL)
+		pipe.Set(ctx, req.templateKey, req.templateName, s.TTL)
+		pipe.SAdd(ctx, req.indexKey, req.id)
+		pipe.Expire(ctx, req.indexKey, s.TTL)
+	}
+	_, err := pipe.Exec(ctx)
+	sh.recordReply(err)
+	if err != nil {
+		log.Printf("Error executing pipelined writes on shard %s: %v", sh.id, err)
+	}
+}
+
+// Flush blocks until every write queued so far has actually been applied -
+// it waits on the worker's ack of a completed drain, not merely on the
+// signal being received. It is a no-op when async writes are not enabled.
+func (s *Storage) Flush(ctx context.Context) error {
+	if !s.async {
+		return nil
+	}
+	ack := make(chan struct{})
+	select {
+	case s.signalCh <- controlSignal{kind: "flush", ack: ack}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close drains any queued writes and stops the async write worker. Callers
+// (e.g. a SIGTERM handler in main) should call this before the process
+// exits so in-flight writes aren't lost. It is a no-op when async writes
+// are not enabled.
+func (s *Storage) Close(ctx context.Context) error {
+	if !s.async {
+		return nil
+	}
+	ack := make(chan struct{})
+	select {
+	case s.signalCh <- controlSignal{kind: "close", ack: ack}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.writeWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
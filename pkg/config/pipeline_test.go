@@ -0,0 +1,93 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFlushNoopWhenAsyncDisabled(t *testing.T) {
+	s := &Storage{}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("expected nil error when async writes are disabled, got %v", err)
+	}
+}
+
+func TestCloseNoopWhenAsyncDisabled(t *testing.T) {
+	s := &Storage{}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("expected nil error when async writes are disabled, got %v", err)
+	}
+}
+
+// TestFlushHonorsContextCancellationWhenWorkerUnavailable drives Flush against a signalCh with
+// no reader (the worker isn't running), so the only way it can return is
+// via ctx.Done() - this proves Flush doesn't unblock on anything but
+// either a real ack or a cancelled context.
+func TestFlushHonorsContextCancellationWhenWorkerUnavailable(t *testing.T) {
+	s := &Storage{async: true, signalCh: make(chan controlSignal)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.Flush(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCloseHonorsContextCancellationWhenWorkerUnavailable(t *testing.T) {
+	s := &Storage{async: true, signalCh: make(chan controlSignal)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.Close(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// TestFlushDrainsQueuedWritesBeforeReturning exercises the real worker
+// against a shard that can never reach Redis (nothing listens on the
+// port), so applyBatch's pipeline Exec fails and is merely logged. What
+// this checks is the contract callers actually rely on: by the time Flush
+// returns, every request that was sitting in writeCh has been taken off
+// it, not just signaled - regression test for the bug where the worker
+// closed the ack as soon as it received the signal, before drainPending
+// ran.
+func TestFlushDrainsQueuedWritesBeforeReturning(t *testing.T) {
+	sh, err := newShard("shard-0", "redis://127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("newShard: %v", err)
+	}
+	s := &Storage{
+		Shards:       &shardPool{shards: []*shard{sh}},
+		Organization: "org",
+		TTL:          time.Second,
+	}
+	s.StartAsyncWrites()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		s.Close(ctx)
+	}()
+
+	for i := 0; i < 5; i++ {
+		s.writeCh <- writeRequest{
+			shard:        sh,
+			key:          fmt.Sprintf("{org}:%d", i),
+			content:      "x",
+			templateKey:  fmt.Sprintf("{org}:template:%d", i),
+			templateName: "t",
+			indexKey:     "{org}:tmpl:t",
+			id:           fmt.Sprintf("%d", i),
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+	if n := len(s.writeCh); n != 0 {
+		t.Fatalf("Flush returned with %d writes still queued", n)
+	}
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+const maxConsecutiveShardErrors = 3
+
+// shardHealthCheckInterval is how often an unhealthy shard is pinged so it
+// can recover. Without this, a shard nothing is routing reads or writes to
+// would never get the err==nil reply recordResult needs to set healthy again.
+const shardHealthCheckInterval = 10 * time.Second
+
+// shard wraps one Redis endpoint in the pool, tracking consecutive failures
+// so it can be taken out of rotation for new writes once it looks down,
+// while reads keep trying it (the data may only live there).
+type shard struct {
+	id     string
+	client *redis.Client
+
+	mu             sync.Mutex
+	consecutiveErr int
+	healthy        bool
+}
+
+func newShard(id, url string) (*shard, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis url for shard %s: %w", id, err)
+	}
+	opt.DB = 0
+	opt.IdleTimeout = time.Second * 60
+	opt.IdleCheckFrequency = time.Second * 5
+	return &shard{id: id, client: redis.NewClient(opt), healthy: true}, nil
+}
+
+// recordResult updates the shard's health based on the outcome of a
+// command. Pass nil for redis.Nil ("key not found") too - a Nil means the
+// shard answered, so it is healthy, it just didn't have the key.
+func (sh *shard) recordResult(err error) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if err == nil {
+		sh.consecutiveErr = 0
+		sh.healthy = true
+		return
+	}
+	sh.consecutiveErr++
+	if sh.consecutiveErr >= maxConsecutiveShardErrors && sh.healthy {
+		sh.healthy = false
+		log.Printf("Shard %s marked unhealthy after %d consecutive errors", sh.id, sh.consecutiveErr)
+	}
+}
+
+func (sh *shard) recordReply(err error) {
+	if err == redis.Nil {
+		sh.recordResult(nil)
+		return
+	}
+	sh.recordResult(err)
+}
+
+func (sh *shard) isHealthy() bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.healthy
+}
+
+// healthCheckLoop pings sh on a timer and feeds the result back through
+// recordResult, so a shard marked unhealthy can recover even if nothing is
+// routing writes or reads to it (e.g. it has no canonical keys for the
+// current traffic). It never returns.
+func (sh *shard) healthCheckLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if sh.isHealthy() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err := sh.client.Ping(ctx).Err()
+		cancel()
+		sh.recordResult(err)
+		if err == nil {
+			log.Printf("Shard %s recovered", sh.id)
+		}
+	}
+}
+
+// shardPool picks a shard for each key via rendezvous (highest random
+// weight, HRW) hashing: every shard scores the key and the highest score
+// wins. Adding or removing a shard only reshuffles the keys that scored
+// highest for the changed shard, instead of the whole keyspace the way
+// modulo hashing would.
+type shardPool struct {
+	shards []*shard
+}
+
+// newShardPool builds a pool from REDIS_URLS (comma-separated) when set, or
+// falls back to a single-endpoint pool from REDIS_URL.
+func newShardPool() (*shardPool, error) {
+	var endpoints []string
+	if urls := os.Getenv("REDIS_URLS"); urls != "" {
+		for _, u := range strings.Split(urls, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				endpoints = append(endpoints, u)
+			}
+		}
+	} else if single := os.Getenv("REDIS_URL"); single != "" {
+		endpoints = []string{single}
+	}
+
+	pool := &shardPool{}
+	for i, url := range endpoints {
+		sh, err := newShard(fmt.Sprintf("shard-%d", i), url)
+		if err != nil {
+			return nil, err
+		}
+		pool.shards = append(pool.shards, sh)
+	}
+	for _, sh := range pool.shards {
+		go sh.healthCheckLoop(shardHealthCheckInterval)
+	}
+	return pool, nil
+}
+
+func (p *shardPool) all() []*shard {
+	return p.shards
+}
+
+// hashTag returns the part of key between the first "{" and its matching
+// "}", mirroring Redis Cluster's hash-tag convention - our keys are always
+// "{org}:...", so every key for an organization has the same canonical
+// shard. Writes made while that shard is unhealthy go to a failover shard,
+// which is why GetAll and RemoveByTemplate still visit every shard.
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end >= 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+func score(shardID, tag string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(shardID))
+	h.Write([]byte(tag))
+	return h.Sum64()
+}
+
+// orderedShards returns every shard for key, highest HRW score first - the
+// same failover order pickForWrite walks to find a healthy shard.
+func (p *shardPool) orderedShards(key string) []*shard {
+	tag := hashTag(key)
+	ordered := make([]*shard, len(p.shards))
+	copy(ordered, p.shards)
+	sort.Slice(ordered, func(i, j int) bool {
+		return score(ordered[i].id, tag) > score(ordered[j].id, tag)
+	})
+	return ordered
+}
+
+// pickForWrite returns the highest-scoring healthy shard for key, falling
+// back to the overall highest-scoring shard if every shard looks unhealthy
+// (better to try and fail than to refuse the write outright).
+func (p *shardPool) pickForWrite(key string) *shard {
+	ordered := p.orderedShards(key)
+	for _, sh := range ordered {
+		if sh.isHealthy() {
+			return sh
+		}
+	}
+	return ordered[0]
+}
+
+// candidatesForRead returns every shard for key in the order a read should
+// probe them: the canonical (highest-scoring) shard first - where data
+// written before any failover still lives - then each failover shard in
+// the same order pickForWrite would have tried them. Callers should try
+// each in turn and stop at the first hit, since the data could be on
+// either depending on whether the canonical shard was healthy at write
+// time.
+func (p *shardPool) candidatesForRead(key string) []*shard {
+	return p.orderedShards(key)
+}
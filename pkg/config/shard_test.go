@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+func newTestShard(id string, healthy bool) *shard {
+	return &shard{id: id, healthy: healthy}
+}
+
+func idsOf(shards []*shard) []string {
+	ids := make([]string, len(shards))
+	for i, sh := range shards {
+		ids[i] = sh.id
+	}
+	return ids
+}
+
+func TestOrderedShardsIsDeterministicByScore(t *testing.T) {
+	pool := &shardPool{shards: []*shard{
+		newTestShard("shard-0", true),
+		newTestShard("shard-1", true),
+		newTestShard("shard-2", true),
+	}}
+	key := "{org1}:some-config"
+
+	first := pool.orderedShards(key)
+	second := pool.orderedShards(key)
+	if len(first) != 3 || len(second) != 3 {
+		t.Fatalf("expected 3 shards, got %d and %d", len(first), len(second))
+	}
+	for i := range first {
+		if first[i].id != second[i].id {
+			t.Fatalf("orderedShards not deterministic: %v vs %v", idsOf(first), idsOf(second))
+		}
+	}
+
+	tag := hashTag(key)
+	for i := 0; i < len(first)-1; i++ {
+		if score(first[i].id, tag) < score(first[i+1].id, tag) {
+			t.Fatalf("orderedShards not sorted by descending score")
+		}
+	}
+}
+
+func TestPickForWriteFailsOverToNextHealthyShard(t *testing.T) {
+	pool := &shardPool{shards: []*shard{
+		newTestShard("shard-0", true),
+		newTestShard("shard-1", true),
+		newTestShard("shard-2", true),
+	}}
+	key := "{org1}:some-config"
+	canonical := pool.orderedShards(key)[0]
+
+	canonical.healthy = false
+	picked := pool.pickForWrite(key)
+	if picked.id == canonical.id {
+		t.Fatalf("pickForWrite still returned unhealthy canonical shard %s", canonical.id)
+	}
+	if !picked.isHealthy() {
+		t.Fatalf("pickForWrite returned unhealthy shard %s", picked.id)
+	}
+}
+
+func TestPickForWriteFallsBackToCanonicalWhenAllUnhealthy(t *testing.T) {
+	pool := &shardPool{shards: []*shard{
+		newTestShard("shard-0", false),
+		newTestShard("shard-1", false),
+		newTestShard("shard-2", false),
+	}}
+	key := "{org1}:some-config"
+	canonical := pool.orderedShards(key)[0]
+
+	picked := pool.pickForWrite(key)
+	if picked.id != canonical.id {
+		t.Fatalf("expected fallback to canonical shard %s, got %s", canonical.id, picked.id)
+	}
+}
+
+func TestCandidatesForReadIncludesUnhealthyCanonicalFirst(t *testing.T) {
+	pool := &shardPool{shards: []*shard{
+		newTestShard("shard-0", true),
+		newTestShard("shard-1", false),
+		newTestShard("shard-2", true),
+	}}
+	key := "{org1}:some-config"
+	ordered := pool.orderedShards(key)
+	ordered[0].healthy = false
+	candidates := pool.candidatesForRead(key)
+
+	if len(candidates) != len(ordered) {
+		t.Fatalf("expected %d candidates, got %d", len(ordered), len(candidates))
+	}
+	for i := range ordered {
+		if candidates[i].id != ordered[i].id {
+			t.Fatalf("candidatesForRead does not match orderedShards at %d: %s vs %s", i, candidates[i].id, ordered[i].id)
+		}
+	}
+	// Unlike pickForWrite, candidatesForRead must not filter out the
+	// canonical shard just because it's unhealthy - data written before
+	// the failover still lives there.
+	if candidates[0].id != ordered[0].id {
+		t.Fatalf("expected canonical shard first regardless of health")
+	}
+}
+
+func TestShardRecordResultHealthTransitions(t *testing.T) {
+	sh := newTestShard("shard-0", true)
+	boom := errors.New("boom")
+	for i := 0; i < maxConsecutiveShardErrors; i++ {
+		sh.recordResult(boom)
+	}
+	if sh.isHealthy() {
+		t.Fatalf("expected shard to be unhealthy after %d consecutive errors", maxConsecutiveShardErrors)
+	}
+
+	sh.recordResult(nil)
+	if !sh.isHealthy() {
+		t.Fatalf("expected shard to recover after a successful result")
+	}
+	if sh.consecutiveErr != 0 {
+		t.Fatalf("expected consecutiveErr reset to 0, got %d", sh.consecutiveErr)
+	}
+}
+
+func TestShardRecordReplyTreatsRedisNilAsHealthy(t *testing.T) {
+	sh := newTestShard("shard-0", true)
+	sh.consecutiveErr = maxConsecutiveShardErrors - 1
+
+	sh.recordReply(redis.Nil)
+	if !sh.isHealthy() {
+		t.Fatalf("redis.Nil (key not found) should not count as a shard failure")
+	}
+	if sh.consecutiveErr != 0 {
+		t.Fatalf("expected consecutiveErr reset after redis.Nil, got %d", sh.consecutiveErr)
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ServeEvents streams this Storage's config/template events to the client
+// as Server-Sent Events. Callers can narrow the stream with the "template"
+// query parameter (exact match) and/or "id_prefix" (prefix match on
+// Event.ID); either filter is skipped when empty.
+func (s *Storage) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	template := r.URL.Query().Get("template")
+	idPrefix := r.URL.Query().Get("id_prefix")
+
+	ch, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case ev, open := <-ch:
+			if !open {
+				return
+			}
+			if template != "" && ev.Template != template {
+				continue
+			}
+			if idPrefix != "" && !strings.HasPrefix(ev.ID, idPrefix) {
+				continue
+			}
+
+			payload, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", payload)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -7,70 +7,150 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
-
-	redis "github.com/go-redis/redis/v8"
 )
 
 type Storage struct {
-	UseRedis     bool
-	MemoryStore  map[string]string
-	MemoryTemplateMap map[string]string  // Maps config ID to template name
-	RedisStore   *redis.Client
-	Organization string
-	TTL          time.Duration
+	UseRedis            bool
+	MemoryStore         map[string]string
+	MemoryTemplateMap   map[string]string   // Maps config ID to template name
+	MemoryTemplateIndex map[string][]string // Maps template name to the config IDs it produced
+	Shards              *shardPool
+	Organization        string
+	TTL                 time.Duration
+
+	subMu       sync.RWMutex
+	subscribers []chan Event
+
+	async     bool
+	asyncOnce sync.Once
+	writeCh   chan writeRequest
+	signalCh  chan controlSignal
+	writeWG   sync.WaitGroup
 }
 
 func InitStorage() (*Storage, error) {
 	orgName := os.Getenv("ORG_NAME")
 	useRedis := os.Getenv("USE_REDIS") == "true"
 	if useRedis {
-		redisOpt, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+		shards, err := newShardPool()
 		if err != nil {
 			return nil, err
 		}
-		redisOpt.DB = 0
-		redisOpt.IdleTimeout = time.Second * 60
-		redisOpt.IdleCheckFrequency = time.Second * 5
-		redisClient := redis.NewClient(redisOpt)
+		if len(shards.all()) == 0 {
+			return nil, fmt.Errorf("USE_REDIS is true but neither REDIS_URLS nor REDIS_URL is set")
+		}
 		ttlNum := 259200
 		ttlEnv := os.Getenv("REDIS_TTL")
 		if len(ttlEnv) > 0 {
 			ttlNum, _ = strconv.Atoi(ttlEnv)
 		}
 		ttlDuration := time.Duration(ttlNum) * time.Second
-		return &Storage{RedisStore: redisClient, UseRedis: true, MemoryTemplateMap: make(map[string]string), Organization: orgName, TTL: ttlDuration}, nil
+		storage := &Storage{Shards: shards, UseRedis: true, MemoryTemplateMap: make(map[string]string), MemoryTemplateIndex: make(map[string][]string), Organization: orgName, TTL: ttlDuration}
+		storage.startRedisEventRelay()
+		return storage, nil
 	} else {
-		return &Storage{MemoryStore: make(map[string]string), MemoryTemplateMap: make(map[string]string), UseRedis: false, Organization: orgName}, nil
+		return &Storage{MemoryStore: make(map[string]string), MemoryTemplateMap: make(map[string]string), MemoryTemplateIndex: make(map[string][]string), UseRedis: false, Organization: orgName}, nil
 	}
 }
 
+// SetTemplateConfig stores content under the ID derived from tc, so that
+// multiple templates (or multiple renders of the same template against
+// different inputs/destinations) never collide under a single config ID.
+func (s *Storage) SetTemplateConfig(tc TemplateConfig, content string) error {
+	return s.SetWithTemplate(tc.ID(), content, tc.TemplateName)
+}
+
 func (s *Storage) SetWithTemplate(id string, content string, templateName string) error {
 	key := fmt.Sprintf("{%s}:%s", s.Organization, id)
 	if s.UseRedis {
-		// For Redis, store the config content and separately track the template relationship
+		// key, templateKey and indexKey all share the {org} hash tag, so
+		// they resolve to the same shard - pick it once and reuse it.
+		templateKey := fmt.Sprintf("{%s}:template:%s", s.Organization, id)
+		indexKey := fmt.Sprintf("{%s}:tmpl:%s", s.Organization, templateName)
+		sh := s.Shards.pickForWrite(key)
+
+		// If id was previously tracked under a different template, drop it
+		// from that template's reverse index first - otherwise it lingers
+		// there and RemoveByTemplate(oldName) would delete a config that no
+		// longer belongs to it.
 		ctx := context.Background()
-		err := s.RedisStore.Set(ctx, key, content, 0).Err()
-		if err != nil {
-			return err
-		}
-		_, err = s.RedisStore.Expire(ctx, key, s.TTL).Result()
-		if err != nil {
-			return err
+		if oldTemplateName, err := sh.client.Get(ctx, templateKey).Result(); err == nil && oldTemplateName != "" && oldTemplateName != templateName {
+			oldIndexKey := fmt.Sprintf("{%s}:tmpl:%s", s.Organization, oldTemplateName)
+			if err := sh.client.SRem(ctx, oldIndexKey, id).Err(); err != nil {
+				log.Printf("Error de-indexing %s from old template %s: %v", id, oldTemplateName, err)
+			}
 		}
-		// Store the template information (this would require additional Redis keys or approach)
-		templateKey := fmt.Sprintf("{%s}:template:%s", s.Organization, id)
-		err = s.RedisStore.Set(ctx, templateKey, templateName, s.TTL).Err()
-		if err != nil {
-			return err
+
+		if s.async {
+			s.writeCh <- writeRequest{
+				shard: sh, key: key, content: content,
+				templateKey: templateKey, templateName: templateName,
+				indexKey: indexKey, id: id,
+			}
+		} else {
+			err := sh.client.Set(ctx, key, content, 0).Err()
+			sh.recordReply(err)
+			if err != nil {
+				return err
+			}
+			_, err = sh.client.Expire(ctx, key, s.TTL).Result()
+			sh.recordReply(err)
+			if err != nil {
+				return err
+			}
+			// Store the template information (this would require additional Redis keys or approach)
+			err = sh.client.Set(ctx, templateKey, templateName, s.TTL).Err()
+			sh.recordReply(err)
+			if err != nil {
+				return err
+			}
+			// Track this config under its template's reverse index so
+			// RemoveByTemplate can find it without scanning every org key.
+			err = sh.client.SAdd(ctx, indexKey, id).Err()
+			sh.recordReply(err)
+			if err != nil {
+				return err
+			}
+			_, err = sh.client.Expire(ctx, indexKey, s.TTL).Result()
+			sh.recordReply(err)
+			if err != nil {
+				return err
+			}
 		}
 	} else {
+		if oldTemplateName, existed := s.MemoryTemplateMap[key]; existed && oldTemplateName != templateName {
+			s.MemoryTemplateIndex[oldTemplateName] = removeString(s.MemoryTemplateIndex[oldTemplateName], id)
+		}
 		s.MemoryStore[key] = content
 		s.MemoryTemplateMap[key] = templateName
+		if !containsString(s.MemoryTemplateIndex[templateName], id) {
+			s.MemoryTemplateIndex[templateName] = append(s.MemoryTemplateIndex[templateName], id)
+		}
 	}
+	s.publish(newEvent("set", id, templateName, s.Organization))
 	return nil
 }
 
+func containsString(haystack []string, needle string) bool {
+	for _, v := range haystack {
+		if v == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(haystack []string, needle string) []string {
+	for i, v := range haystack {
+		if v == needle {
+			return append(haystack[:i], haystack[i+1:]...)
+		}
+	}
+	return haystack
+}
+
 func (s *Storage) Set(id string, content string) error {
 	// For backward compatibility, call SetWithTemplate with a default template name
 	return s.SetWithTemplate(id, content, "unknown")
@@ -81,11 +161,14 @@ func (s *Storage) GetTemplate(id string) (string, error) {
 	if s.UseRedis {
 		ctx := context.Background()
 		templateKey := fmt.Sprintf("{%s}:template:%s", s.Organization, id)
-		templateName, err := s.RedisStore.Get(ctx, templateKey).Result()
-		if err != nil {
-			return "", fmt.Errorf("Template information not found for config: %s", id)
+		for _, sh := range s.Shards.candidatesForRead(templateKey) {
+			templateName, err := sh.client.Get(ctx, templateKey).Result()
+			sh.recordReply(err)
+			if err == nil {
+				return templateName, nil
+			}
 		}
-		return templateName, nil
+		return "", fmt.Errorf("Template information not found for config: %s", id)
 	} else {
 		templateKey := fmt.Sprintf("{%s}:%s", s.Organization, id)
 		templateName, exists := s.MemoryTemplateMap[templateKey]
@@ -96,66 +179,55 @@ func (s *Storage) GetTemplate(id string) (string, error) {
 	}
 }
 
-// RemoveByTemplate removes all configs that were generated from the specified template
+// RemoveByTemplate removes all configs that were generated from the specified
+// template. It consults the templateName -> []configID reverse index rather
+// than scanning every key in the organization, so cost is proportional to
+// the number of configs the template actually produced.
 func (s *Storage) RemoveByTemplate(templateName string) error {
 	if s.UseRedis {
-		// For Redis, we need to scan all keys to find configs generated from the template
 		ctx := context.Background()
-		orgPrefix := fmt.Sprintf("{%s}:", s.Organization)
-		matchPattern := fmt.Sprintf("%s*", orgPrefix)
-
-		// Scan for all config keys first
-		var cursor uint64
-		for {
-			var configKeys []string
-			var err error
-			configKeys, cursor, err = s.RedisStore.Scan(ctx, cursor, matchPattern, 100).Result()
-			if err != nil {
-				return err
-			}
+		indexKey := fmt.Sprintf("{%s}:tmpl:%s", s.Organization, templateName)
 
-			// Check each config key to see if it was generated from the template
-			for _, configKey := range configKeys {
-				// Skip template tracking keys and other metadata keys
-				if strings.Contains(configKey, ":template:") {
-					continue
-				}
+		// Writes made while the canonical shard was unhealthy went to a
+		// failover shard along with their index entries, so every shard
+		// holding a piece of the index is cleaned, not just the first.
+		found := false
+		for _, sh := range s.Shards.candidatesForRead(indexKey) {
+			ids, err := sh.client.SMembers(ctx, indexKey).Result()
+			sh.recordReply(err)
+			if err != nil || len(ids) == 0 {
+				continue
+			}
+			found = true
 
-				// Get the template for this config
-				templateKey := fmt.Sprintf("%s:template:%s", orgPrefix, strings.TrimPrefix(configKey, orgPrefix))
-				storedTemplateName, err := s.RedisStore.Get(ctx, templateKey).Result()
-				if err != nil || storedTemplateName != templateName {
-					continue
-				}
+			for _, id := range ids {
+				configKey := fmt.Sprintf("{%s}:%s", s.Organization, id)
+				templateKey := fmt.Sprintf("{%s}:template:%s", s.Organization, id)
 
-				// Remove both the config and its template tracking
-				err = s.RedisStore.Del(ctx, configKey).Err()
-				if err != nil {
+				if err := sh.client.Del(ctx, configKey).Err(); err != nil {
 					log.Printf("Error deleting config key %s: %v", configKey, err)
 				}
-				err = s.RedisStore.Del(ctx, templateKey).Err()
-				if err != nil {
+				if err := sh.client.Del(ctx, templateKey).Err(); err != nil {
 					log.Printf("Error deleting template key %s: %v", templateKey, err)
 				}
 			}
 
-			if cursor == 0 {
-				break
+			if err := sh.client.Del(ctx, indexKey).Err(); err != nil {
+				log.Printf("Error deleting template index key %s: %v", indexKey, err)
 			}
 		}
-	} else {
-		// For memory store, we can directly iterate through the template map
-		keysToRemove := []string{}
-		for configKey, storedTemplateName := range s.MemoryTemplateMap {
-			if storedTemplateName == templateName {
-				delete(s.MemoryStore, configKey)
-				keysToRemove = append(keysToRemove, configKey)
-			}
+		if !found {
+			return nil
 		}
-		for _, key := range keysToRemove {
-			delete(s.MemoryTemplateMap, key)
+	} else {
+		for _, id := range s.MemoryTemplateIndex[templateName] {
+			configKey := fmt.Sprintf("{%s}:%s", s.Organization, id)
+			delete(s.MemoryStore, configKey)
+			delete(s.MemoryTemplateMap, configKey)
 		}
+		delete(s.MemoryTemplateIndex, templateName)
 	}
+	s.publishTemplateEvent("remove", templateName)
 	return nil
 }
 
@@ -163,11 +235,19 @@ func (s *Storage) Get(id string) (string, error) {
 	key := fmt.Sprintf("{%s}:%s", s.Organization, id)
 	if s.UseRedis {
 		ctx := context.Background()
-		value, err := s.RedisStore.Get(ctx, key).Result()
-		if err != nil {
-			return "", fmt.Errorf("Key (id) does not exist: %s", id)
+		// Check the canonical shard first, then fall back through the same
+		// failover order pickForWrite uses - the config may have been
+		// written to a failover shard while the canonical one was
+		// unhealthy, or still live on the canonical shard from before any
+		// failover happened.
+		for _, sh := range s.Shards.candidatesForRead(key) {
+			value, err := sh.client.Get(ctx, key).Result()
+			sh.recordReply(err)
+			if err == nil {
+				return value, nil
+			}
 		}
-		return value, nil
+		return "", fmt.Errorf("Key (id) does not exist: %s", id)
 	} else {
 		value, exists := s.MemoryStore[key]
 		if !exists {
@@ -177,32 +257,87 @@ func (s *Storage) Get(id string) (string, error) {
 	}
 }
 
+// metadataKeyPrefixes lists the {org}:-relative prefixes used for
+// bookkeeping keys (template name lookup, template reverse index) rather
+// than actual config content, so GetAll's SCAN over {org}:* can skip them.
+var metadataKeyPrefixes = []string{"template:", "tmpl:"}
+
+func isMetadataKeySuffix(suffix string) bool {
+	for _, prefix := range metadataKeyPrefixes {
+		if strings.HasPrefix(suffix, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAll lists every config ID stored for the organization. In Redis mode
+// the {org} hash tag gives all of them the same canonical shard, but writes
+// made while that shard was unhealthy land on a failover shard, so the SCAN
+// fans out to every shard concurrently and the results are merged.
+// Bookkeeping keys (template:<id>, tmpl:<name>) are filtered out since
+// they aren't config IDs.
 func (s *Storage) GetAll() ([]string, error) {
-	result := make([]string, 0)
 	orgPrefix := fmt.Sprintf("{%s}:", s.Organization)
 	if s.UseRedis {
-		ctx := context.Background()
-		scanCount := 100
 		match := fmt.Sprintf("%s*", orgPrefix)
-		var cursor uint64
-		for {
-			var ks []string
-			var err error
-			ks, cursor, err = s.RedisStore.Scan(ctx, cursor, match, int64(scanCount)).Result()
-			if err != nil {
-				return nil, err
-			}
-			for _, k := range ks {
-				result = append(result, strings.TrimPrefix(k, orgPrefix))
+
+		type scanResult struct {
+			keys []string
+			err  error
+		}
+		shards := s.Shards.all()
+		results := make(chan scanResult, len(shards))
+		var wg sync.WaitGroup
+		for _, sh := range shards {
+			wg.Add(1)
+			go func(sh *shard) {
+				defer wg.Done()
+				ctx := context.Background()
+				scanCount := 100
+				var cursor uint64
+				var keys []string
+				for {
+					ks, next, err := sh.client.Scan(ctx, cursor, match, int64(scanCount)).Result()
+					sh.recordReply(err)
+					if err != nil {
+						results <- scanResult{err: err}
+						return
+					}
+					keys = append(keys, ks...)
+					cursor = next
+					if cursor == 0 {
+						break
+					}
+				}
+				results <- scanResult{keys: keys}
+			}(sh)
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		result := make([]string, 0)
+		for r := range results {
+			if r.err != nil {
+				log.Printf("Error scanning shard: %v", r.err)
+				continue
 			}
-			if cursor == 0 {
-				break
+			for _, k := range r.keys {
+				id := strings.TrimPrefix(k, orgPrefix)
+				if isMetadataKeySuffix(id) {
+					continue
+				}
+				result = append(result, id)
 			}
 		}
+		return result, nil
 	} else {
-		for k, _ := range s.MemoryStore {
+		result := make([]string, 0)
+		for k := range s.MemoryStore {
 			result = append(result, strings.TrimPrefix(k, orgPrefix))
 		}
+		return result, nil
 	}
-	return result, nil
 }
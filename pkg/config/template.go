@@ -1,23 +1,56 @@
 package config
 
 import (
-	"html/template"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
+
+	"github.com/Tkrtt/alloy-remote-config-server/pkg/secrets"
 	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	templates            = make(map[string]*template.Template)
+	templateEnabledFuncs = make(map[string][]string) // template name -> enabled builtin func names
+	configFolder         = "conf"
 )
 
 var (
-	templates              = make(map[string]*template.Template)
-	globalStorage *Storage = nil
-	configFolder           = "conf" 
+	globalStorage  *Storage
+	secretProvider secrets.SecretProvider
 )
 
+// defaultBuiltinFuncs lists every sprig-style helper enabled for a template
+// unless its sibling funcs.json narrows the list (see loadTemplateFuncsConfig).
+var defaultBuiltinFuncs = []string{
+	"toYaml", "indent", "nindent", "default", "env", "required",
+	"quote", "b64enc", "sha256sum", "regexReplaceAll", "list", "dict",
+}
+
 func LoadTemplates(path string) error {
 	configFolder = path
+	if secretProvider == nil {
+		provider, err := secrets.NewProviderFromEnv()
+		if err != nil {
+			return err
+		}
+		secretProvider = provider
+	}
+
 	files, err := filepath.Glob(filepath.Join(path, "*.conf.tmpl"))
 	if err != nil {
 		return err
@@ -42,6 +75,7 @@ func LoadTemplates(path string) error {
 	// Remove templates that no longer exist
 	for _, templateName := range templatesToRemove {
 		delete(templates, templateName)
+		delete(templateEnabledFuncs, templateName)
 		log.Printf("Removed template: %s", templateName)
 		// Clean up configs that were generated from this template
 		if globalStorage != nil {
@@ -61,17 +95,204 @@ func LoadTemplates(path string) error {
 			return err
 		}
 		fullName := filepath.Base(file)
-		tmpl, err := template.New(fullName).Parse(string(content))
+
+		funcsCfg, err := loadTemplateFuncsConfig(file + ".funcs.json")
+		if err != nil {
+			return err
+		}
+		enabled := defaultBuiltinFuncs
+		if funcsCfg != nil {
+			enabled = funcsCfg.Enabled
+		}
+
+		// Parse with a FuncMap on a throwaway cache so secret/secrets calls
+		// are valid at parse time; RenderTemplate swaps in a FuncMap with a
+		// fresh cache before each execution.
+		tmpl, err := template.New(fullName).Funcs(funcMap(secrets.NewRenderCache(secretProvider), enabled)).Parse(string(content))
 		if err != nil {
 			return err
 		}
 		trimmedName := strings.TrimSuffix(fullName, ".conf.tmpl")
 		templates[trimmedName] = tmpl
+		templateEnabledFuncs[trimmedName] = enabled
+
+		// Let subscribers know this template was (re)loaded so they can
+		// refetch any configs it produces.
+		if globalStorage != nil {
+			globalStorage.publishTemplateEvent("reload", trimmedName)
+		}
 	}
 
 	return nil
 }
 
+// RenderTemplate executes the named template against data. Each call gets
+// its own secret-lookup cache, so a template reading the same path more
+// than once only hits the secret backend once per render.
+//
+// When globalStorage is set, the rendered output is also persisted through
+// Storage.SetTemplateConfig, keyed by a TemplateConfig derived from the
+// template name and the serialized input data, so two renders of the same
+// template against different data (or two different templates rendering
+// to the same name) get distinct, stable config IDs instead of clobbering
+// one another.
+func RenderTemplate(name string, data interface{}) (string, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return "", fmt.Errorf("template not found: %s", name)
+	}
+
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	clone = clone.Funcs(funcMap(secrets.NewRenderCache(secretProvider), templateEnabledFuncs[name]))
+
+	var buf bytes.Buffer
+	if err := clone.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	rendered := buf.String()
+
+	if globalStorage != nil {
+		inputs, err := json.Marshal(data)
+		if err != nil {
+			inputs = []byte(fmt.Sprintf("%v", data))
+		}
+		tc := TemplateConfig{TemplateName: name, Inputs: string(inputs), Destination: name}
+		if err := globalStorage.SetTemplateConfig(tc, rendered); err != nil {
+			return "", fmt.Errorf("storing rendered config for template %s: %w", name, err)
+		}
+	}
+
+	return rendered, nil
+}
+
+// templateFuncsConfig declares which of the default sprig-style helpers a
+// single template wants enabled. It's loaded from an optional sibling
+// "{name}.conf.tmpl.funcs.json" file - a plain declaration rather than a Go
+// plugin, so enabling/disabling a helper never requires a rebuild.
+type templateFuncsConfig struct {
+	Enabled []string `json:"enabled"`
+}
+
+// loadTemplateFuncsConfig reads confPath if it exists, returning nil (not
+// an error) when it doesn't - callers should fall back to
+// defaultBuiltinFuncs in that case.
+func loadTemplateFuncsConfig(confPath string) (*templateFuncsConfig, error) {
+	data, err := ioutil.ReadFile(confPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg templateFuncsConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", confPath, err)
+	}
+	return &cfg, nil
+}
+
+// funcMap builds the FuncMap available to .conf.tmpl files: the
+// secret-lookup functions (always on, backed by cache so repeated calls
+// within one render are free) plus whichever builtins are in enabled.
+func funcMap(cache *secrets.RenderCache, enabled []string) template.FuncMap {
+	fm := template.FuncMap{
+		"secret": func(path string) (string, error) {
+			return cache.Get(path)
+		},
+		"secrets": func(path string) (map[string]string, error) {
+			return cache.List(path)
+		},
+		"toJson": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return string(b), nil
+		},
+	}
+
+	builtins := builtinFuncMap()
+	for _, name := range enabled {
+		if fn, ok := builtins[name]; ok {
+			fm[name] = fn
+		}
+	}
+	return fm
+}
+
+// builtinFuncMap returns every sprig-style helper a template may enable.
+func builtinFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"toYaml": func(v interface{}) (string, error) {
+			b, err := yaml.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(string(b), "\n"), nil
+		},
+		"indent": func(spaces int, s string) string {
+			pad := strings.Repeat(" ", spaces)
+			return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+		},
+		"nindent": func(spaces int, s string) string {
+			pad := strings.Repeat(" ", spaces)
+			return "\n" + pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+		},
+		"default": func(def, val interface{}) interface{} {
+			if val == nil || val == "" {
+				return def
+			}
+			return val
+		},
+		"env": func(name string) string {
+			return os.Getenv(name)
+		},
+		"required": func(msg string, val interface{}) (interface{}, error) {
+			if val == nil || val == "" {
+				return nil, errors.New(msg)
+			}
+			return val, nil
+		},
+		"quote": func(s string) string {
+			return strconv.Quote(s)
+		},
+		"b64enc": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"sha256sum": func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"regexReplaceAll": func(pattern, s, repl string) (string, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return "", err
+			}
+			return re.ReplaceAllString(s, repl), nil
+		},
+		"list": func(items ...interface{}) []interface{} {
+			return items
+		},
+		"dict": func(pairs ...interface{}) (map[string]interface{}, error) {
+			if len(pairs)%2 != 0 {
+				return nil, fmt.Errorf("dict requires an even number of arguments")
+			}
+			d := make(map[string]interface{}, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				key, ok := pairs[i].(string)
+				if !ok {
+					return nil, fmt.Errorf("dict keys must be strings")
+				}
+				d[key] = pairs[i+1]
+			}
+			return d, nil
+		},
+	}
+}
+
 // StartTemplateWatcher watches the config folder for changes and reloads templates
 func StartTemplateWatcher(path string) {
 	watcher, err := fsnotify.NewWatcher()
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// TemplateConfig identifies one logical config produced by rendering a
+// template against a particular set of inputs, destined for a particular
+// location. Two configs that happen to share a template name but differ
+// in the inputs or destination get distinct, stable IDs instead of
+// colliding under one key - mirroring how consul-template disambiguates
+// two templates that share a target but differ in source.
+type TemplateConfig struct {
+	TemplateName string
+	Inputs       string // rendered/serialized input used to derive the ID
+	Destination  string
+}
+
+// ID returns a deterministic identifier for this template/inputs/destination
+// triple, stable across restarts so the same logical config always maps to
+// the same storage key.
+func (t TemplateConfig) ID() string {
+	h := sha256.Sum256([]byte(t.TemplateName + "\x00" + t.Inputs + "\x00" + t.Destination))
+	return hex.EncodeToString(h[:])[:16]
+}
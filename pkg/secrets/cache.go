@@ -0,0 +1,47 @@
+package secrets
+
+// RenderCache wraps a SecretProvider and memoizes its results for the
+// lifetime of one template render, so a template calling {{ secret "x" }}
+// more than once only hits the backend once per path, and likewise for
+// {{ secrets "x" }}. Get and List are cached separately, so mixing the two
+// over the same path still issues one backend call per function, not one
+// total - they don't currently share a cache key.
+type RenderCache struct {
+	provider SecretProvider
+	values   map[string]string
+	lists    map[string]map[string]string
+}
+
+// NewRenderCache wraps provider in a fresh, empty cache. A new RenderCache
+// must be created for each render.
+func NewRenderCache(provider SecretProvider) *RenderCache {
+	return &RenderCache{
+		provider: provider,
+		values:   make(map[string]string),
+		lists:    make(map[string]map[string]string),
+	}
+}
+
+func (c *RenderCache) Get(path string) (string, error) {
+	if v, ok := c.values[path]; ok {
+		return v, nil
+	}
+	v, err := c.provider.Get(path)
+	if err != nil {
+		return "", err
+	}
+	c.values[path] = v
+	return v, nil
+}
+
+func (c *RenderCache) List(path string) (map[string]string, error) {
+	if v, ok := c.lists[path]; ok {
+		return v, nil
+	}
+	v, err := c.provider.List(path)
+	if err != nil {
+		return nil, err
+	}
+	c.lists[path] = v
+	return v, nil
+}
@@ -0,0 +1,40 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envProvider resolves secrets from process environment variables. A path
+// such as "db/password" is upper-cased and slashes are replaced with
+// underscores, so it reads DB_PASSWORD.
+type envProvider struct{}
+
+// NewEnvProvider returns the environment-variable SecretProvider.
+func NewEnvProvider() SecretProvider {
+	return envProvider{}
+}
+
+func (envProvider) Get(path string) (string, error) {
+	name := envVarName(path)
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("secret not found: %s (env var %s unset)", path, name)
+	}
+	return value, nil
+}
+
+// List is not supported by the env backend: there is no reliable way to
+// enumerate "variables under a prefix" without scanning the whole
+// environment and guessing at path boundaries.
+func (envProvider) List(path string) (map[string]string, error) {
+	return nil, fmt.Errorf("env secret backend does not support listing a path: %s", path)
+}
+
+func envVarName(path string) string {
+	name := strings.ToUpper(path)
+	name = strings.ReplaceAll(name, "/", "_")
+	name = strings.ReplaceAll(name, "-", "_")
+	return name
+}
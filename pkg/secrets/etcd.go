@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdProvider resolves secrets from etcd, where each key under a path
+// prefix is treated as a field of that path's secret.
+type etcdProvider struct {
+	client *clientv3.Client
+}
+
+// NewEtcdProvider builds a SecretProvider backed by etcd, configured via
+// ETCD_ENDPOINTS (comma-separated).
+func NewEtcdProvider() (SecretProvider, error) {
+	endpoints := os.Getenv("ETCD_ENDPOINTS")
+	if endpoints == "" {
+		return nil, fmt.Errorf("ETCD_ENDPOINTS must be set when SECRET_BACKEND=etcd")
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to etcd: %w", err)
+	}
+	return &etcdProvider{client: client}, nil
+}
+
+func (e *etcdProvider) Get(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("etcd get %s: %w", path, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return "", fmt.Errorf("secret not found: %s", path)
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// List returns every key under the path prefix, with the prefix stripped
+// and remaining path separators dot-joined (e.g. "foo/bar/baz" under
+// prefix "foo/" becomes "bar.baz").
+func (e *etcdProvider) List(path string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	resp, err := e.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("etcd list %s: %w", path, err)
+	}
+
+	result := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key := strings.TrimPrefix(string(kv.Key), prefix)
+		key = strings.ReplaceAll(key, "/", ".")
+		result[key] = string(kv.Value)
+	}
+	return result, nil
+}
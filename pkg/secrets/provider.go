@@ -0,0 +1,54 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+)
+
+// SecretProvider resolves secret values from an external backend at
+// template render time.
+type SecretProvider interface {
+	// Get returns the single value stored at path.
+	Get(path string) (string, error)
+	// List returns every value stored under path, with nested keys
+	// dot-joined (e.g. a Vault field "foo" holding the map {"bar": "x"}
+	// becomes "foo.bar" -> "x"). The result is a flat map[string]string, so
+	// only {{ index . "foo.bar" }} reaches a nested value - {{ .foo.bar }}
+	// looks up a "foo" key that doesn't exist and renders "<no value>".
+	List(path string) (map[string]string, error)
+}
+
+// NewProviderFromEnv builds a SecretProvider based on the SECRET_BACKEND
+// environment variable ("vault", "etcd", or "env"). It defaults to the env
+// backend when unset.
+func NewProviderFromEnv() (SecretProvider, error) {
+	switch backend := os.Getenv("SECRET_BACKEND"); backend {
+	case "", "env":
+		return NewEnvProvider(), nil
+	case "vault":
+		return NewVaultProvider()
+	case "etcd":
+		return NewEtcdProvider()
+	default:
+		return nil, fmt.Errorf("unknown secret backend: %s", backend)
+	}
+}
+
+// flattenDotJoin merges src into dst, prefixing each of src's keys with
+// prefix (joined with a dot) when prefix is non-empty.
+func flattenDotJoin(dst map[string]string, prefix string, src map[string]interface{}) {
+	for k, v := range src {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case map[string]interface{}:
+			flattenDotJoin(dst, key, val)
+		case string:
+			dst[key] = val
+		default:
+			dst[key] = fmt.Sprintf("%v", val)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultProvider resolves secrets from HashiCorp Vault's KV secrets engine,
+// transparently handling both the v2 (versioned) and v1 layouts.
+type vaultProvider struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// NewVaultProvider builds a SecretProvider backed by Vault, configured via
+// VAULT_ADDR and VAULT_TOKEN.
+func NewVaultProvider() (SecretProvider, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR must be set when SECRET_BACKEND=vault")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("VAULT_TOKEN must be set when SECRET_BACKEND=vault")
+	}
+	return &vaultProvider{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Get returns a single value. When the path resolves to a map instead of a
+// scalar (common for KV v2, where secrets are stored as a bag of fields),
+// the map is flattened and the "value" field (or, failing that, the sole
+// remaining field) is returned.
+func (v *vaultProvider) Get(path string) (string, error) {
+	data, err := v.read(path)
+	if err != nil {
+		return "", err
+	}
+	flat := make(map[string]string)
+	flattenDotJoin(flat, "", data)
+	if val, ok := flat["value"]; ok {
+		return val, nil
+	}
+	if len(flat) == 1 {
+		for _, val := range flat {
+			return val, nil
+		}
+	}
+	return "", fmt.Errorf("secret at %s is not a single value; use {{ secrets %q }} instead", path, path)
+}
+
+// List flattens every field under path, dot-joining nested keys.
+func (v *vaultProvider) List(path string) (map[string]string, error) {
+	data, err := v.read(path)
+	if err != nil {
+		return nil, err
+	}
+	flat := make(map[string]string)
+	flattenDotJoin(flat, "", data)
+	return flat, nil
+}
+
+func (v *vaultProvider) read(path string) (map[string]interface{}, error) {
+	path = strings.TrimPrefix(path, "/")
+	if data, err := v.readKV2(path); err == nil {
+		return data, nil
+	}
+	return v.readKV1(path)
+}
+
+func (v *vaultProvider) readKV1(path string) (map[string]interface{}, error) {
+	return v.request(fmt.Sprintf("%s/v1/secret/%s", v.addr, path))
+}
+
+func (v *vaultProvider) readKV2(path string) (map[string]interface{}, error) {
+	mount, rest := splitMount(path)
+	return v.request(fmt.Sprintf("%s/v1/%s/data/%s", v.addr, mount, rest))
+}
+
+func (v *vaultProvider) request(url string) (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault request to %s returned status %d", url, resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding vault response: %w", err)
+	}
+
+	// KV v2 nests the actual payload one level deeper, under data.data.
+	if nested, ok := body.Data["data"].(map[string]interface{}); ok {
+		return nested, nil
+	}
+	return body.Data, nil
+}
+
+// splitMount splits "secret/foo/bar" into mount "secret" and remainder
+// "foo/bar", defaulting to the conventional "secret" mount when path has no
+// slash.
+func splitMount(path string) (mount, rest string) {
+	idx := strings.Index(path, "/")
+	if idx < 0 {
+		return "secret", path
+	}
+	return path[:idx], path[idx+1:]
+}